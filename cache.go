@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	cacheFreshTTL = 30 * time.Second // cached entries at most this old are served without revalidation
+	cacheStaleTTL = cacheExpiration  // cached entries at most this old are still served while a refresh runs in the background
+)
+
+// Cache stores the last known numbers for a URL alongside the time they were recorded, so callers
+// can layer stale-while-revalidate semantics on top of any backend. Every method takes a context
+// so a backend that talks over the network (e.g. Redis) can be bounded by the caller's deadline
+// instead of blocking past it.
+type Cache interface {
+	Get(ctx context.Context, url string) (numbers []int, storedAt time.Time, ok bool)
+	Set(ctx context.Context, url string, numbers []int)
+	Delete(ctx context.Context, url string)
+}
+
+// cacheEntry is the value stored for each URL: the numbers returned by the upstream and when
+// they were recorded.
+type cacheEntry struct {
+	Numbers  []int     `json:"numbers"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// newCacheFromEnv picks the cache backend at startup: a Redis backend when REDIS_ADDR is set,
+// otherwise the in-process default.
+func newCacheFromEnv() Cache {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		log.Printf("using redis cache backend at %s", addr)
+		return newRedisCache(addr)
+	}
+
+	return newMemoryCache()
+}
+
+// memoryCache is the default in-process Cache backend, backed by patrickmn/go-cache.
+type memoryCache struct {
+	store *gocache.Cache
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{store: gocache.New(cacheStaleTTL, 0)}
+}
+
+// Get ignores ctx: the in-process store never blocks on I/O.
+func (m *memoryCache) Get(ctx context.Context, url string) ([]int, time.Time, bool) {
+	val, ok := m.store.Get(url)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	entry, ok := val.(cacheEntry)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	return entry.Numbers, entry.StoredAt, true
+}
+
+// Set ignores ctx: the in-process store never blocks on I/O.
+func (m *memoryCache) Set(ctx context.Context, url string, numbers []int) {
+	m.store.Set(url, cacheEntry{Numbers: numbers, StoredAt: time.Now()}, cacheStaleTTL)
+}
+
+// Delete ignores ctx: the in-process store never blocks on I/O.
+func (m *memoryCache) Delete(ctx context.Context, url string) {
+	m.store.Delete(url)
+}
+
+// redisCache is a Cache backend for sharing results across multiple server instances.
+type redisCache struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func newRedisCache(addr string) *redisCache {
+	return &redisCache{
+		rdb: redis.NewClient(&redis.Options{Addr: addr}),
+		ttl: cacheStaleTTL,
+	}
+}
+
+func (r *redisCache) Get(ctx context.Context, url string) ([]int, time.Time, bool) {
+	val, err := r.rdb.Get(ctx, url).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("redis cache get failed for URL %s: %s", url, err)
+		}
+
+		return nil, time.Time{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(val, &entry); err != nil {
+		log.Printf("redis cache decode failed for URL %s: %s", url, err)
+		return nil, time.Time{}, false
+	}
+
+	return entry.Numbers, entry.StoredAt, true
+}
+
+func (r *redisCache) Set(ctx context.Context, url string, numbers []int) {
+	entry := cacheEntry{Numbers: numbers, StoredAt: time.Now()}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("redis cache encode failed for URL %s: %s", url, err)
+		return
+	}
+
+	if err := r.rdb.Set(ctx, url, b, r.ttl).Err(); err != nil {
+		log.Printf("redis cache set failed for URL %s: %s", url, err)
+	}
+}
+
+func (r *redisCache) Delete(ctx context.Context, url string) {
+	if err := r.rdb.Del(ctx, url).Err(); err != nil {
+		log.Printf("redis cache delete failed for URL %s: %s", url, err)
+	}
+}
+
+// refreshing tracks which URLs currently have a background revalidation in flight, so repeated
+// stale hits for the same URL schedule at most one refresh at a time.
+var refreshing sync.Map
+
+// scheduleBackgroundRefresh kicks off a detached refetch of url to bring the cache back up to
+// date, deduping concurrent stale hits for the same URL via refreshing and sharing the upstream
+// request with any synchronous caller via reqGroup.
+func scheduleBackgroundRefresh(url string) {
+	if _, alreadyRunning := refreshing.LoadOrStore(url, struct{}{}); alreadyRunning {
+		return
+	}
+
+	go func() {
+		defer refreshing.Delete(url)
+
+		breaker := urlBreakers.get(url)
+		if !breaker.allow() {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutGetReq)
+		defer cancel()
+
+		numbers, err := getNumbersCoalesced(ctx, url, breaker)
+		if err != nil {
+			log.Printf("background refresh failed for URL %s: %s", url, err)
+
+			return
+		}
+
+		if len(numbers) > 0 {
+			updateCache(url, numbers)
+		}
+	}()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCache is an in-memory, test-only Cache implementation that allows seeding entries with an
+// arbitrary age, which the real backends don't expose.
+type fakeCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{entries: make(map[string]cacheEntry)}
+}
+
+func (f *fakeCache) Get(ctx context.Context, url string) ([]int, time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[url]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	return entry.Numbers, entry.StoredAt, true
+}
+
+func (f *fakeCache) Set(ctx context.Context, url string, numbers []int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries[url] = cacheEntry{Numbers: numbers, StoredAt: time.Now()}
+}
+
+func (f *fakeCache) Delete(ctx context.Context, url string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.entries, url)
+}
+
+// noopCache is a Cache that never has anything cached, for tests that need every call to fall
+// through to a live request.
+type noopCache struct{}
+
+func (noopCache) Get(ctx context.Context, url string) ([]int, time.Time, bool) {
+	return nil, time.Time{}, false
+}
+
+func (noopCache) Set(ctx context.Context, url string, numbers []int) {}
+
+func (noopCache) Delete(ctx context.Context, url string) {}
+
+func (f *fakeCache) seed(url string, numbers []int, storedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries[url] = cacheEntry{Numbers: numbers, StoredAt: storedAt}
+}
+
+func TestGetResponseFromURLStaleWhileRevalidate(t *testing.T) {
+	rq := require.New(t)
+
+	fake := newFakeCache()
+
+	original := defaultClient.cache
+	defaultClient.cache = fake
+
+	defer func() { defaultClient.cache = original }()
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond)
+
+		err := json.NewEncoder(w).Encode(payload{Numbers: []int{3, 4}})
+		rq.NoError(err)
+	}))
+
+	defer server.Close()
+
+	fake.seed(server.URL, []int{1, 2}, time.Now().Add(-cacheFreshTTL-time.Second))
+
+	const concurrency = 5
+
+	var wg sync.WaitGroup
+
+	ch := make(chan result, concurrency)
+
+	start := time.Now()
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			getResponseFromURL(context.Background(), ch, server.URL)
+		}()
+	}
+
+	wg.Wait()
+
+	rq.Less(time.Since(start), 15*time.Millisecond, "stale hits must be served from cache without blocking on the upstream")
+
+	close(ch)
+
+	for res := range ch {
+		rq.Equal([]int{1, 2}, res.data.Numbers)
+	}
+
+	rq.Eventually(func() bool {
+		numbers, _, ok := fake.Get(context.Background(), server.URL)
+		return ok && len(numbers) > 0 && numbers[0] == 3
+	}, time.Second, 5*time.Millisecond, "background refresh should have updated the cache")
+
+	rq.EqualValues(1, atomic.LoadInt32(&hits), "concurrent stale hits must dedupe to a single background refresh")
+}
+
+func TestGetResponseFromURLFreshCacheSkipsUpstream(t *testing.T) {
+	rq := require.New(t)
+
+	fake := newFakeCache()
+
+	original := defaultClient.cache
+	defaultClient.cache = fake
+
+	defer func() { defaultClient.cache = original }()
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+
+	defer server.Close()
+
+	fake.seed(server.URL, []int{1, 2}, time.Now())
+
+	ch := make(chan result, 1)
+	getResponseFromURL(context.Background(), ch, server.URL)
+
+	rq.Equal([]int{1, 2}, (<-ch).data.Numbers)
+	rq.EqualValues(0, atomic.LoadInt32(&hits))
+}
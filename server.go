@@ -1,18 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"sort"
+	"sync"
 	"time"
 
-	"github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
 )
 
 type payload struct {
-	Numbers []int `json:"numbers"`
+	Numbers []int  `json:"numbers"`
+	Error   string `json:"error,omitempty"`
 }
 
 type result struct {
@@ -20,27 +25,173 @@ type result struct {
 }
 
 const (
-	timeoutServer   = 500 * time.Millisecond // total timeout of the server
-	timeoutGetReq   = 400 * time.Millisecond // total timeout when sending GET request for each given URL
-	cacheExpiration = 10 * time.Minute
+	timeoutServer    = 500 * time.Millisecond // total timeout of the server
+	timeoutGetReq    = 400 * time.Millisecond // total timeout when sending GET request for each given URL
+	timeoutPreMargin = 30 * time.Millisecond  // how long before timeoutServer we pre-empt the handler and flush an error response
+	cacheExpiration  = 10 * time.Minute
+
+	breakerFailureThreshold = 5                // consecutive failures before a URL's breaker trips open
+	breakerFailureWindow    = 10 * time.Second // consecutive failures older than this no longer count towards the threshold
+	breakerCooldown         = 5 * time.Second  // how long an open breaker short-circuits to cache before letting a probe through
+
+	maxIdleConnsPerHost = 20               // keep-alive connections retained per upstream host
+	idleConnTimeout     = 90 * time.Second // how long an idle keep-alive connection is kept around
+	dialTimeout         = 5 * time.Second  // bound on establishing a new connection
+	dialKeepAlive       = 30 * time.Second // TCP keep-alive probe interval for the dialer
 )
 
-const errServer = "error occurred in server"
+const (
+	errServer  = "error occurred in server"
+	errTimeout = "server timeout"
+)
 
+// client owns the resources shared by every fan-out call: the response cache and a persistent
+// HTTP client whose Transport pools and reuses keep-alive connections across requests instead of
+// dialing fresh for every URL.
 type client struct {
-	cache cache.Cache
-	urls  []string
+	cache      Cache
+	urls       []string
+	httpClient *http.Client
 }
 
-var serverCache = cache.New(cacheExpiration, 0)
+// newClient builds a client backed by a Transport tuned for fan-out traffic against a small,
+// recurring set of upstream URLs: generous per-host idle connection pooling and a bounded dialer.
+func newClient() *client {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		DisableKeepAlives:   false,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+		}).DialContext,
+	}
 
-func main() {
+	return &client{
+		cache:      newCacheFromEnv(),
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+// defaultClient is shared across all fan-out calls so keep-alive connections are actually reused
+// when the same URLs appear across many /numbers requests.
+var defaultClient = newClient()
+
+// reqGroup coalesces concurrent GETs for the same URL into a single upstream request, sharing
+// the result across every waiter instead of dialing once per caller.
+var reqGroup singleflight.Group
+
+// urlBreakers tracks one circuit breaker per URL so a flapping upstream doesn't get dialed on
+// every fan-out call once it has proven unreliable.
+var urlBreakers = newBreakerRegistry()
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker is a closed -> open -> half-open state machine for a single URL. It opens after
+// breakerFailureThreshold failures within breakerFailureWindow of one another, short-circuits to
+// the cache for breakerCooldown, then admits exactly one probe request to decide whether to close
+// again; every other caller is short-circuited to the cache until that probe records a result.
+type circuitBreaker struct {
+	mu               sync.Mutex
+	state            breakerState
+	consecutiveFails int
+	lastFailureAt    time.Time
+	openedAt         time.Time
+}
+
+// allow reports whether a request should be dialed. An expired open breaker flips to half-open
+// and admits the caller that makes that transition as the sole probe; every subsequent caller
+// sees the already-half-open state and is short-circuited until the probe reports back.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerHalfOpen:
+		return false
+	default: // breakerOpen
+		if time.Since(b.openedAt) < breakerCooldown {
+			return false
+		}
+
+		b.state = breakerHalfOpen
+
+		return true
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFails = 0
+	b.state = breakerClosed
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if b.state == breakerHalfOpen {
+		// The probe itself failed: go straight back to open without waiting for the full
+		// threshold to accumulate again.
+		b.consecutiveFails = breakerFailureThreshold
+		b.lastFailureAt = now
+		b.state = breakerOpen
+		b.openedAt = now
+
+		return
+	}
+
+	if b.consecutiveFails > 0 && now.Sub(b.lastFailureAt) > breakerFailureWindow {
+		b.consecutiveFails = 0
+	}
+
+	b.consecutiveFails++
+	b.lastFailureAt = now
 
-	http.HandleFunc("/number", numbersHandler)
+	if b.consecutiveFails >= breakerFailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+}
+
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerRegistry() *breakerRegistry {
+	return &breakerRegistry{breakers: make(map[string]*circuitBreaker)}
+}
+
+func (r *breakerRegistry) get(url string) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[url]
+	if !ok {
+		b = &circuitBreaker{}
+		r.breakers[url] = b
+	}
+
+	return b
+}
 
+func main() {
 	server := http.Server{
 		Addr:    ":8080",
-		Handler: http.TimeoutHandler(http.HandlerFunc(numbersHandler), timeoutServer, "server timeout!"),
+		Handler: timeoutMiddleware(numbersHandler, timeoutServer),
 	}
 
 	if err := server.ListenAndServe(); err != nil {
@@ -48,6 +199,110 @@ func main() {
 	}
 }
 
+// timeoutMiddleware runs next in its own goroutine and races it against a timer that fires
+// timeoutPreMargin before timeout expires. Whichever finishes first writes the response; the
+// pre-timeout path always has enough slack left on the connection to flush a well-formed JSON
+// error instead of letting net/http truncate a chunked body out from under the handler.
+func timeoutMiddleware(next http.HandlerFunc, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		r = r.WithContext(ctx)
+
+		tw := newBufferedResponseWriter()
+		handlerDone := make(chan struct{})
+
+		var once sync.Once
+		responded := make(chan struct{})
+
+		go func() {
+			next(tw, r)
+			close(handlerDone)
+			once.Do(func() {
+				flushBuffered(w, tw)
+				close(responded)
+			})
+		}()
+
+		preTimeout := timeout - timeoutPreMargin
+		if preTimeout < 0 {
+			preTimeout = 0
+		}
+
+		timer := time.NewTimer(preTimeout)
+		defer timer.Stop()
+
+		go func() {
+			select {
+			case <-timer.C:
+				once.Do(func() {
+					writeTimeoutResponse(w)
+					close(responded)
+				})
+			case <-handlerDone:
+			}
+		}()
+
+		<-responded
+	}
+}
+
+// bufferedResponseWriter buffers a handler's response so it can either be flushed verbatim or
+// discarded in favour of a pre-timeout error, without ever partially writing to the real
+// http.ResponseWriter.
+type bufferedResponseWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// flushBuffered copies a completed, buffered response onto the real ResponseWriter with an
+// explicit Content-Length so the client never sees a truncated chunked body.
+func flushBuffered(w http.ResponseWriter, tw *bufferedResponseWriter) {
+	for key, values := range tw.header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(tw.body.Len()))
+	w.WriteHeader(tw.statusCode)
+
+	_, _ = w.Write(tw.body.Bytes())
+}
+
+// writeTimeoutResponse writes the pre-timeout error body while the connection still has slack
+// left before timeoutServer actually expires.
+func writeTimeoutResponse(w http.ResponseWriter) {
+	body, err := json.Marshal(payload{Numbers: []int{}, Error: errTimeout})
+	if err != nil {
+		log.Fatalf("%s: %s", errServer, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	_, _ = w.Write(body)
+}
+
 func numbersHandler(w http.ResponseWriter, r *http.Request) {
 	log.Print("processing the request")
 
@@ -61,7 +316,7 @@ func numbersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 
 	queryValues := r.URL.Query()
 
@@ -100,7 +355,26 @@ func processURLs(ctx context.Context, urls []string) []result {
 	return results
 }
 
+// getResponseFromURL implements stale-while-revalidate on top of defaultClient.cache: a fresh
+// cached entry is returned as-is, a stale-but-not-expired one is returned immediately while a
+// background refresh brings it up to date, and anything else falls through to a live request.
 func getResponseFromURL(ctx context.Context, ch chan result, url string) {
+	if numbers, storedAt, ok := defaultClient.cache.Get(ctx, url); ok {
+		age := time.Since(storedAt)
+
+		if age <= cacheFreshTTL {
+			ch <- result{data: payload{Numbers: numbers}}
+			return
+		}
+
+		if age <= cacheStaleTTL {
+			ch <- result{data: payload{Numbers: numbers}}
+			scheduleBackgroundRefresh(url)
+
+			return
+		}
+	}
+
 	select {
 	case <-ctx.Done():
 		log.Printf("timeout reached for URL: %s. Fetching result from cache...", url)
@@ -111,27 +385,44 @@ func getResponseFromURL(ctx context.Context, ch chan result, url string) {
 	}
 }
 
+// getResultFromCache is used on fallback paths where the caller's own context may already be
+// expired or cancelled, so it bounds the cache read with a fresh timeoutGetReq deadline of its
+// own rather than inheriting one that's already done.
 func getResultFromCache(url string) []int {
-	var data []int
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutGetReq)
+	defer cancel()
 
-	val, ok := serverCache.Get(url)
-	if ok {
-		data, _ = val.([]int) // not required to check the bool value as we insert only []int type in cache.
+	numbers, _, ok := defaultClient.cache.Get(ctx, url)
+	if !ok {
+		return nil
 	}
 
-	return data
+	return numbers
 }
 
 func updateCache(url string, numbers []int) {
-	serverCache.Delete(url)
-	serverCache.Add(url, numbers, cacheExpiration)
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutGetReq)
+	defer cancel()
+
+	defaultClient.cache.Set(ctx, url, numbers)
 }
 
 // makeGetRequestForURL makes a GET request to the given URL and returns the result in the given channel.
+// Concurrent calls for the same URL are coalesced into a single upstream request via reqGroup, and
+// a per-URL circuit breaker short-circuits straight to the cache once the URL has proven unreliable.
 func makeGetRequestForURL(ctx context.Context, url string, ch chan result) {
+	breaker := urlBreakers.get(url)
+
+	if !breaker.allow() {
+		log.Printf("circuit open for URL %s. Fetching result from cache", url)
+		ch <- result{data: payload{Numbers: getResultFromCache(url)}}
+
+		return
+	}
+
 	log.Printf("sending GET request to URL %s", url)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	numbers, err := getNumbersCoalesced(ctx, url, breaker)
 	if err != nil {
 		// If an error is encountered, ignore the error and return cached result
 		log.Printf("%s. Fetching result from cache", err)
@@ -140,34 +431,58 @@ func makeGetRequestForURL(ctx context.Context, url string, ch chan result) {
 		return
 	}
 
-	client := http.DefaultClient
+	// if we successfully reach till here, and the returned numbers from URL is not empty, then update cache.
+	if len(numbers) > 0 {
+		updateCache(url, numbers)
+	}
 
-	var numbers payload
+	ch <- result{data: payload{Numbers: numbers}}
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("%s. Fetching result from cache", err)
-		ch <- result{data: payload{Numbers: getResultFromCache(url)}}
+// getNumbersCoalesced dials url and decodes its payload, sharing a single in-flight request
+// across all callers that ask for the same URL concurrently. The upstream may respond with a
+// single JSON payload or a gzip-compressed/NDJSON stream; see decodeUpstreamResponse. The breaker
+// outcome is recorded once per coalesced upstream attempt, inside the singleflight closure, so
+// that a fan-out of waiters sharing one failed call doesn't each count as a separate failure.
+func getNumbersCoalesced(ctx context.Context, url string, breaker *circuitBreaker) ([]int, error) {
+	v, err, _ := reqGroup.Do(url, func() (interface{}, error) {
+		numbers, err := fetchNumbers(ctx, url)
+		if err != nil {
+			breaker.recordFailure()
+			return nil, err
+		}
 
-		return
+		breaker.recordSuccess()
+
+		return numbers, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return v.([]int), nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&numbers); err != nil {
-		// If an error is encountered, ignore the error and return cached result
-		log.Printf("%s. Fetching result from cache", err)
-		ch <- result{data: payload{Numbers: getResultFromCache(url)}}
+// fetchNumbers performs the actual upstream GET and decodes its payload.
+func fetchNumbers(ctx context.Context, url string) ([]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
 
-		return
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := defaultClient.httpClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// if we successfully reach till here, and the returned numbers from URL is not empty, then update cache.
-	if len(numbers.Numbers) > 0 {
-		updateCache(url, numbers.Numbers)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("upstream returned status %d for URL %s", resp.StatusCode, url)
 	}
 
-	ch <- result{data: numbers}
+	return decodeUpstreamResponse(ctx, resp)
 }
 
 // processFinalResult processes the result returned by each URL. It removes the duplicate, sorts them and returns a
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -131,6 +134,226 @@ func TestProcessUrls(t *testing.T) {
 	})
 }
 
+func TestTimeoutMiddleware(t *testing.T) {
+	t.Run("handler finishes in time", func(t *testing.T) {
+		rq := require.New(t)
+
+		handler := timeoutMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"numbers":[1,2]}`))
+		}, 100*time.Millisecond)
+
+		request := httptest.NewRequest(http.MethodGet, "/numbers", nil)
+		response := httptest.NewRecorder()
+
+		handler(response, request)
+
+		rq.Equal(http.StatusOK, response.Code)
+		rq.JSONEq(`{"numbers":[1,2]}`, response.Body.String())
+		rq.Equal(fmt.Sprint(len(`{"numbers":[1,2]}`)), response.Header().Get("Content-Length"))
+	})
+
+	t.Run("handler exceeds timeout", func(t *testing.T) {
+		rq := require.New(t)
+
+		handler := timeoutMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"numbers":[1,2]}`))
+		}, 20*time.Millisecond)
+
+		request := httptest.NewRequest(http.MethodGet, "/numbers", nil)
+		response := httptest.NewRecorder()
+
+		handler(response, request)
+
+		rq.Equal(http.StatusServiceUnavailable, response.Code)
+		rq.JSONEq(`{"numbers":[],"error":"server timeout"}`, response.Body.String())
+		rq.Equal(fmt.Sprint(response.Body.Len()), response.Header().Get("Content-Length"))
+	})
+}
+
+func TestMakeGetRequestForURLCoalescing(t *testing.T) {
+	rq := require.New(t)
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond) // keep the request in-flight long enough for waiters to coalesce
+
+		err := json.NewEncoder(w).Encode(payload{Numbers: []int{1, 2}})
+		rq.NoError(err)
+	}))
+
+	defer server.Close()
+
+	const concurrency = 5
+
+	var wg sync.WaitGroup
+
+	ch := make(chan result, concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			makeGetRequestForURL(context.Background(), server.URL, ch)
+		}()
+	}
+
+	wg.Wait()
+	close(ch)
+
+	count := 0
+	for res := range ch {
+		rq.Equal([]int{1, 2}, res.data.Numbers)
+		count++
+	}
+
+	rq.Equal(concurrency, count)
+	rq.EqualValues(1, atomic.LoadInt32(&hits))
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	rq := require.New(t)
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+
+	updateCache(server.URL, []int{9})
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		ch := make(chan result, 1)
+		makeGetRequestForURL(context.Background(), server.URL, ch)
+		rq.Equal([]int{9}, (<-ch).data.Numbers)
+	}
+
+	rq.EqualValues(breakerFailureThreshold, atomic.LoadInt32(&hits))
+
+	// breaker is now open: further calls short-circuit to the cache without dialing.
+	ch := make(chan result, 1)
+	makeGetRequestForURL(context.Background(), server.URL, ch)
+	rq.Equal([]int{9}, (<-ch).data.Numbers)
+	rq.EqualValues(breakerFailureThreshold, atomic.LoadInt32(&hits))
+
+	breaker := urlBreakers.get(server.URL)
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-breakerCooldown)
+	breaker.mu.Unlock()
+
+	// cooldown elapsed: the breaker should let a half-open probe reach the upstream again.
+	ch = make(chan result, 1)
+	makeGetRequestForURL(context.Background(), server.URL, ch)
+	<-ch
+	rq.EqualValues(breakerFailureThreshold+1, atomic.LoadInt32(&hits))
+}
+
+func TestCircuitBreakerCoalescedFailureCountsOnce(t *testing.T) {
+	rq := require.New(t)
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond) // keep the request in-flight long enough for waiters to coalesce
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+
+	updateCache(server.URL, []int{9})
+
+	const concurrency = breakerFailureThreshold
+
+	var wg sync.WaitGroup
+
+	ch := make(chan result, concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			makeGetRequestForURL(context.Background(), server.URL, ch)
+		}()
+	}
+
+	wg.Wait()
+	close(ch)
+
+	for res := range ch {
+		rq.Equal([]int{9}, res.data.Numbers)
+	}
+
+	rq.EqualValues(1, atomic.LoadInt32(&hits), "concurrent waiters must coalesce into a single upstream attempt")
+
+	breaker := urlBreakers.get(server.URL)
+	breaker.mu.Lock()
+	fails, state := breaker.consecutiveFails, breaker.state
+	breaker.mu.Unlock()
+
+	rq.Equal(1, fails, "a single coalesced failure must only be recorded once, not once per waiter")
+	rq.Equal(breakerClosed, state)
+}
+
+func TestCircuitBreakerHalfOpenAdmitsSingleProbe(t *testing.T) {
+	rq := require.New(t)
+
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer server.Close()
+
+	updateCache(server.URL, []int{9})
+
+	breaker := urlBreakers.get(server.URL)
+	for i := 0; i < breakerFailureThreshold; i++ {
+		breaker.recordFailure()
+	}
+
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-breakerCooldown)
+	breaker.mu.Unlock()
+
+	const concurrency = 5
+
+	var wg sync.WaitGroup
+
+	ch := make(chan result, concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			makeGetRequestForURL(context.Background(), server.URL, ch)
+		}()
+	}
+
+	wg.Wait()
+	close(ch)
+
+	for res := range ch {
+		rq.Equal([]int{9}, res.data.Numbers)
+	}
+
+	rq.EqualValues(1, atomic.LoadInt32(&hits), "only a single half-open probe should reach the upstream concurrently")
+}
+
 func TestNumbersHandler(t *testing.T) {
 	url1 := "http://127.0.0.1:8090/primes"
 	url2 := "http://127.0.0.1:8090/fibo"
@@ -191,3 +414,76 @@ func TestNumbersHandler(t *testing.T) {
 		})
 	}
 }
+
+// countingRoundTripper wraps a Transport and records, via httptrace, how many of the requests
+// it carries reuse an existing connection versus dial a fresh one.
+type countingRoundTripper struct {
+	next     http.RoundTripper
+	requests int32
+	reused   int32
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt32(&c.reused, 1)
+			}
+		},
+	}
+
+	return c.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// BenchmarkProcessURLs fans out to a fixed set of servers repeatedly and asserts that every
+// iteration after the first reuses a pooled keep-alive connection per server instead of dialing
+// a fresh one. The cache is swapped for a no-op one for the duration: otherwise the second and
+// later iterations would be served entirely from the fresh-cache hit left by the first fan-out,
+// leaving nothing for the Transport's connection pool to reuse.
+func BenchmarkProcessURLs(b *testing.B) {
+	rq := require.New(b)
+
+	const numServers = 5
+
+	urls := make([]string, numServers)
+
+	for i := 0; i < numServers; i++ {
+		i := i
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(payload{Numbers: []int{i}})
+		}))
+
+		defer server.Close()
+
+		urls[i] = server.URL
+	}
+
+	counter := &countingRoundTripper{next: defaultClient.httpClient.Transport}
+
+	originalTransport := defaultClient.httpClient.Transport
+	defaultClient.httpClient.Transport = counter
+
+	defer func() { defaultClient.httpClient.Transport = originalTransport }()
+
+	originalCache := defaultClient.cache
+	defaultClient.cache = noopCache{}
+
+	defer func() { defaultClient.cache = originalCache }()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		processURLs(context.Background(), urls)
+	}
+
+	b.StopTimer()
+
+	b.ReportMetric(float64(atomic.LoadInt32(&counter.reused)), "reused-conns")
+	b.ReportMetric(float64(atomic.LoadInt32(&counter.requests)), "requests")
+
+	wantReused := int32((b.N - 1) * numServers)
+	rq.GreaterOrEqual(atomic.LoadInt32(&counter.reused), wantReused, "each iteration after the first should reuse a pooled keep-alive connection per server")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ndjsonContentType is the Content-Type used by upstreams that stream one {"number": N} object
+// per line instead of a single JSON payload.
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonLine is a single line of an NDJSON numbers stream.
+type ndjsonLine struct {
+	Number int `json:"number"`
+}
+
+// decodeUpstreamResponse reads resp's body, transparently un-gzipping it if the upstream
+// compressed it, and decodes either a single JSON payload or an NDJSON stream of
+// {"number": N} objects depending on Content-Type.
+func decodeUpstreamResponse(ctx context.Context, resp *http.Response) ([]int, error) {
+	var body io.Reader = resp.Body
+
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gzReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+
+		body = gzReader
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == ndjsonContentType {
+		return decodeNDJSON(ctx, body)
+	}
+
+	var p payload
+	if err := json.NewDecoder(body).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	return p.Numbers, nil
+}
+
+// decodeNDJSON decodes body line by line so a large upstream payload is never buffered whole,
+// checking ctx between lines so a cancellation aborts the stream instead of reading it to completion.
+func decodeNDJSON(ctx context.Context, body io.Reader) ([]int, error) {
+	scanner := bufio.NewScanner(body)
+
+	var numbers []int
+
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry ndjsonLine
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, err
+		}
+
+		numbers = append(numbers, entry.Number)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return numbers, nil
+}
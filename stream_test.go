@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeGetRequestForURLNDJSON(t *testing.T) {
+	rq := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		fmt.Fprint(w, "{\"number\":1}\n{\"number\":2}\n{\"number\":3}\n")
+	}))
+
+	defer server.Close()
+
+	ch := make(chan result, 1)
+	makeGetRequestForURL(context.Background(), server.URL, ch)
+
+	rq.Equal([]int{1, 2, 3}, (<-ch).data.Numbers)
+}
+
+func TestMakeGetRequestForURLNDJSONGzip(t *testing.T) {
+	rq := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rq.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.Header().Set("Content-Encoding", "gzip")
+
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+
+		for _, n := range []int{7, 8, 9} {
+			fmt.Fprintf(gz, "{\"number\":%d}\n", n)
+		}
+	}))
+
+	defer server.Close()
+
+	ch := make(chan result, 1)
+	makeGetRequestForURL(context.Background(), server.URL, ch)
+
+	rq.Equal([]int{7, 8, 9}, (<-ch).data.Numbers)
+}
+
+func TestMakeGetRequestForURLNDJSONCancellation(t *testing.T) {
+	rq := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+
+		flusher, _ := w.(http.Flusher)
+
+		for i := 0; ; i++ {
+			fmt.Fprintf(w, "{\"number\":%d}\n", i)
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}))
+
+	defer server.Close()
+
+	updateCache(server.URL, []int{42})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan result, 1)
+	done := make(chan struct{})
+
+	go func() {
+		makeGetRequestForURL(ctx, server.URL, ch)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("makeGetRequestForURL did not return after context cancellation")
+	}
+
+	rq.Equal([]int{42}, (<-ch).data.Numbers)
+}